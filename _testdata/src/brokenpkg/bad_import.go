@@ -0,0 +1,5 @@
+package brokenpkg
+
+import "foo/../bar"
+
+var _ = 1
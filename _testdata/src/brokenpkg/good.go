@@ -0,0 +1,5 @@
+package brokenpkg
+
+import "fmt"
+
+var _ = fmt.Sprintf
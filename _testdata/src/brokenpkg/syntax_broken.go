@@ -0,0 +1,4 @@
+package brokenpkg
+
+import (
+	"strconv"
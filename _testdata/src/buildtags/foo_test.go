@@ -0,0 +1,12 @@
+// +build linux
+
+package buildtags
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestPlain(t *testing.T) {
+	_ = strconv.Itoa
+}
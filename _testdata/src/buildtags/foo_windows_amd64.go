@@ -0,0 +1,5 @@
+package buildtags
+
+import "crypto/md5"
+
+var _ = md5.New
@@ -0,0 +1,7 @@
+// +build linux
+
+package buildtags
+
+import "syscall"
+
+var _ = syscall.Getpid
@@ -0,0 +1,7 @@
+// +build darwin,arm64 linux,amd64
+
+package buildtags
+
+import "crypto/sha256"
+
+var _ = sha256.New
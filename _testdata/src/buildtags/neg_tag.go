@@ -0,0 +1,7 @@
+// +build !windows
+
+package buildtags
+
+import "os/user"
+
+var _ = user.Current
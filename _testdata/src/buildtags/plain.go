@@ -0,0 +1,5 @@
+package buildtags
+
+import "fmt"
+
+var _ = fmt.Sprintf
@@ -0,0 +1,12 @@
+package cgoblock
+
+/*
+#cgo LDFLAGS: -lm
+#cgo pkg-config: zlib
+#include <math.h>
+*/
+import "C"
+
+import "fmt"
+
+var _ = fmt.Sprintf
@@ -0,0 +1,10 @@
+package cgopkg
+
+// #cgo LDFLAGS: -lm
+// #cgo pkg-config: zlib
+// #include <math.h>
+import "C"
+
+import "fmt"
+
+var _ = fmt.Sprintf
@@ -0,0 +1,5 @@
+package excludedonly
+
+import "fmt"
+
+var _ = fmt.Sprintf
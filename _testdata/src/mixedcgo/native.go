@@ -0,0 +1,8 @@
+package mixedcgo
+
+// #cgo LDFLAGS: -lpthread
+import "C"
+
+import "fmt"
+
+var _ = fmt.Sprintf
@@ -0,0 +1,5 @@
+package mixedcgo
+
+import "strings"
+
+var _ = strings.ToUpper
@@ -0,0 +1,10 @@
+package simple
+
+import (
+	"sort"
+
+	"github.com/sdboyer/vsolver"
+)
+
+var _ = sort.Strings
+var _ vsolver.Package
@@ -0,0 +1,10 @@
+package simple
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestInternal(t *testing.T) {
+	_ = rand.Int
+}
@@ -0,0 +1,12 @@
+package simple_test
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestExternal(t *testing.T) {
+	_ = sort.Strings
+	_ = strconv.Itoa
+}
@@ -0,0 +1,12 @@
+package simple
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestSimple(t *testing.T) {
+	_ = rand.Int
+	_ = strconv.Itoa
+}
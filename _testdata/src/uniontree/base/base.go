@@ -0,0 +1,5 @@
+package base
+
+import "fmt"
+
+var Name = fmt.Sprintf("base")
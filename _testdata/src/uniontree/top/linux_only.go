@@ -0,0 +1,7 @@
+// +build linux
+
+package top
+
+import "syscall"
+
+var _ = syscall.Getpid
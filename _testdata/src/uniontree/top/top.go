@@ -0,0 +1,10 @@
+package top
+
+import (
+	"sort"
+
+	"uniontree/base"
+)
+
+var _ = sort.Strings
+var _ = base.Name
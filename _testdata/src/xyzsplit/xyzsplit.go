@@ -0,0 +1,5 @@
+package xyzsplit
+
+import "encoding/json"
+
+var _ = json.Marshal
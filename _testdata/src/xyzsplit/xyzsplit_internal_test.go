@@ -0,0 +1,10 @@
+package xyzsplit
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestInternal(t *testing.T) {
+	_ = errors.New
+}
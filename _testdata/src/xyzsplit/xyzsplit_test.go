@@ -0,0 +1,10 @@
+package xyzsplit_test
+
+import (
+	"bufio"
+	"testing"
+)
+
+func TestExternal(t *testing.T) {
+	_ = bufio.NewReader
+}
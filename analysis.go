@@ -0,0 +1,1117 @@
+package vsolver
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Package represents the import-relevant facts about a single Go package,
+// as extracted by listPackages.
+type Package struct {
+	// ImportPath is the canonical import path for the package.
+	ImportPath string
+	// CommentPath is the import path declared via a `// import "..."`
+	// comment on the package clause, if any.
+	CommentPath string
+	// Name is the package's declared name.
+	Name string
+	// Imports is the sorted, deduplicated set of import paths used by the
+	// package's non-test files.
+	Imports []string
+	// TestImports is the sorted, deduplicated set of import paths used by
+	// the package's internal test files - "_test.go" files that still
+	// declare themselves part of the package itself. It does not include
+	// imports used only by an external "foo_test" test package; those
+	// are reported separately on XTestImports, matching the split
+	// go/build.Package and go/packages make.
+	TestImports []string
+	// XTestImports is the sorted, deduplicated set of import paths used
+	// by the package's external test files - "_test.go" files whose
+	// package clause is the package's own name plus "_test". Because an
+	// xtest package is compiled and imported separately from the
+	// package under test, these imports are strictly test-only in a way
+	// TestImports' are not quite as cleanly: nothing outside `go test`
+	// ever pulls them in.
+	XTestImports []string
+	// Errors holds any non-fatal problems encountered while gathering
+	// this package's facts - an unparseable file, say, or a malformed
+	// import path. A file that fails to parse contributes nothing to
+	// Imports/TestImports/XTestImports, and a malformed import path is
+	// dropped while the rest of its file's imports are still harvested;
+	// either way listPackages goes on with the package's other files
+	// rather than aborting.
+	Errors []PackageError
+	// IgnoredGoFiles lists .go files present in the directory that were
+	// excluded from every other field - by a build constraint, a
+	// _GOOS_GOARCH.go filename suffix, or (with cgo disabled) an
+	// `import "C"` - so downstream tooling can warn about them instead
+	// of silently losing track of their existence.
+	IgnoredGoFiles []string
+	// CgoPkgConfig holds the system-level prerequisites declared in
+	// `#cgo LDFLAGS` and `#cgo pkg-config` preamble directives across
+	// the package's cgo files - e.g. "-lm" or "zlib" - so a solver
+	// front-end can validate them before committing to a version that
+	// needs them.
+	CgoPkgConfig []string
+}
+
+// PackageErrorKind categorizes a PackageError, following the split
+// go/packages makes between why a package's facts might be incomplete.
+type PackageErrorKind string
+
+const (
+	// ParseError means a source file failed to parse.
+	ParseError PackageErrorKind = "ParseError"
+	// ListError means a file or directory couldn't be read at all.
+	ListError PackageErrorKind = "ListError"
+	// ImportError means a file parsed fine but one of its import
+	// declarations was malformed.
+	ImportError PackageErrorKind = "ImportError"
+)
+
+// PackageError describes a single non-fatal problem encountered while
+// listing a package.
+type PackageError struct {
+	// Pos is the file, or file:line:col, the error occurred at.
+	Pos string
+	// Kind categorizes the error.
+	Kind PackageErrorKind
+	// Msg is a human-readable description of the problem.
+	Msg string
+}
+
+func (e PackageError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// AnalysisContext pins down the platform and build configuration that
+// listPackages should evaluate source files against - it's the subset of
+// go/build.Context that actually affects file inclusion. The zero value
+// evaluates files against the host's own GOOS/GOARCH, with no extra build
+// tags and cgo disabled.
+type AnalysisContext struct {
+	GOOS, GOARCH string
+	BuildTags    []string
+	CgoEnabled   bool
+}
+
+// buildContext renders ctx as a go/build.Context, so that file inclusion
+// can be decided with the same +build/filename-suffix/cgo semantics the
+// go tool itself uses. GOOS and GOARCH fall back to the host's values
+// when unset, matching go/build.Default.
+func (ctx AnalysisContext) buildContext() *build.Context {
+	bc := build.Default
+	if ctx.GOOS != "" {
+		bc.GOOS = ctx.GOOS
+	}
+	if ctx.GOARCH != "" {
+		bc.GOARCH = ctx.GOARCH
+	}
+	bc.BuildTags = ctx.BuildTags
+	bc.CgoEnabled = ctx.CgoEnabled
+	return &bc
+}
+
+// String renders the context as the GOOS/GOARCH tuple it pins, for use in
+// log and error messages.
+func (ctx AnalysisContext) String() string {
+	bc := ctx.buildContext()
+	return fmt.Sprintf("%s/%s", bc.GOOS, bc.GOARCH)
+}
+
+// wm, or "workmap", is the intermediate form of a package's imports used to
+// compute a reach map. ex holds imports that point outside the tree under
+// analysis; in holds imports that point at a sibling package within that
+// same tree. Only ex imports end up in a reach map - in imports are how
+// wmToReach finds its way to the transitive set of ex imports.
+type wm struct {
+	ex, in map[string]struct{}
+
+	// exTest/inTest and exXTest/inXTest record the external and
+	// internal-tree imports contributed by a package's internal
+	// ("_test.go", same package) and external ("foo_test") test files,
+	// respectively, kept apart from ex/in so that wmToReach can fold
+	// them into a package's reach independently of one another - or
+	// leave both out entirely - via its TestReach argument.
+	exTest, inTest   map[string]struct{}
+	exXTest, inXTest map[string]struct{}
+
+	// errs carries forward any PackageErrors recorded while listing the
+	// package this workmap entry describes, so that wmToReachMap can
+	// propagate them into the resulting ReachMap.
+	errs []PackageError
+
+	// fileRoot and files back the per-file constraint metadata needed to
+	// recompute ex/in for a different AnalysisContext - or unioned across
+	// several - without re-parsing the source tree. They're left zero by
+	// workmaps that are assembled by hand without them (as in most of
+	// this package's own tests), which is fine: reachForTuples treats an empty files slice
+	// as "this workmap isn't retargetable" and returns it unchanged.
+	fileRoot string
+	files    []wmFile
+}
+
+// wmFile records one source file's contribution to a package's workmap,
+// tagged with the filename needed to re-evaluate its build applicability
+// via AnalysisContext.buildContext().MatchFile, and whether it's a cgo
+// file, needed to re-evaluate that applicability against a tuple's
+// CgoEnabled setting the same way listPackagesCached does.
+type wmFile struct {
+	name   string
+	ex, in map[string]struct{}
+	isCgo  bool
+}
+
+// reachForTuples recomputes w's ex/in sets for the union of the given
+// target tuples, by re-checking each recorded file's build applicability
+// against every tuple and keeping the files that match at least one. No
+// source is re-parsed; only the (cheap) build-constraint scan that
+// go/build.Context.MatchFile performs runs again, once per file per
+// tuple.
+//
+// If w wasn't built with per-file tracking (files is empty), it's
+// returned unchanged.
+func (w wm) reachForTuples(tuples ...AnalysisContext) (wm, error) {
+	if len(w.files) == 0 {
+		return w, nil
+	}
+
+	out := wm{
+		ex: make(map[string]struct{}), in: make(map[string]struct{}),
+		exTest: w.exTest, inTest: w.inTest,
+		exXTest: w.exXTest, inXTest: w.inXTest,
+		errs: w.errs, fileRoot: w.fileRoot,
+	}
+	for _, f := range w.files {
+		var included bool
+		for _, t := range tuples {
+			bc := t.buildContext()
+			ok, err := bc.MatchFile(w.fileRoot, f.name)
+			if err != nil {
+				return wm{}, err
+			}
+			if ok && (!f.isCgo || bc.CgoEnabled) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			continue
+		}
+
+		for e := range f.ex {
+			out.ex[e] = struct{}{}
+		}
+		for i := range f.in {
+			out.in[i] = struct{}{}
+		}
+	}
+
+	return out, nil
+}
+
+// TestReach is a bitmask selecting which of a package's test-only
+// imports wmToReach folds into its external reach, on top of its
+// ordinary (non-test) imports. The two kinds are independent: resolving
+// versions for a production build wants neither; resolving for
+// `go test ./...` typically wants both; a tool that only cares whether
+// a package's own tests still build, without worrying about external
+// "foo_test" harnesses, can ask for InternalTestReach alone.
+type TestReach uint8
+
+const (
+	// InternalTestReach folds in the external imports reachable from
+	// each package's own internal ("_test.go", same package) test
+	// files.
+	InternalTestReach TestReach = 1 << iota
+	// XTestReach folds in the external imports reachable from each
+	// package's external ("foo_test") xtest files. Since an xtest
+	// package is never itself imported, this only ever contributes to
+	// the reach of the package whose tests it belongs to - it does not
+	// propagate further through the graph.
+	XTestReach
+)
+
+// wmToReach takes a workmap - describing, for each package in a tree, its
+// external and internal imports - and computes the external reach map:
+// for each package, the transitive closure of external imports reachable
+// by following internal imports. reach selects whether test-only imports
+// contribute to that closure; its zero value considers only production
+// imports, matching the bare two-argument form this function used to be.
+func wmToReach(workmap map[string]wm, basedir string, reach ...TestReach) (map[string][]string, error) {
+	var want TestReach
+	for _, r := range reach {
+		want |= r
+	}
+
+	rm := make(map[string][]string)
+
+	var visit func(pkg string, seen map[string]struct{}) (map[string]struct{}, error)
+	visit = func(pkg string, seen map[string]struct{}) (map[string]struct{}, error) {
+		w, exists := workmap[pkg]
+		if !exists {
+			return nil, fmt.Errorf("%q not present in workmap", pkg)
+		}
+
+		ex := make(map[string]struct{}, len(w.ex))
+		for e := range w.ex {
+			ex[e] = struct{}{}
+		}
+
+		for in := range w.in {
+			if _, cycle := seen[in]; cycle {
+				continue
+			}
+			seen[in] = struct{}{}
+
+			sub, err := visit(in, seen)
+			if err != nil {
+				return nil, err
+			}
+			for e := range sub {
+				ex[e] = struct{}{}
+			}
+		}
+
+		return ex, nil
+	}
+
+	// addTestReach folds pkg's own test-only ex/in sets into ex, using a
+	// fresh visit for each in-tree package the test imports so that only
+	// pkg's own tests are in play - the sibling package's reach is its
+	// ordinary production reach, not its tests'.
+	addTestReach := func(ex map[string]struct{}, testEx, testIn map[string]struct{}) error {
+		for e := range testEx {
+			ex[e] = struct{}{}
+		}
+		for in := range testIn {
+			sub, err := visit(in, map[string]struct{}{in: {}})
+			if err != nil {
+				return err
+			}
+			for e := range sub {
+				ex[e] = struct{}{}
+			}
+		}
+		return nil
+	}
+
+	for pkg := range workmap {
+		ex, err := visit(pkg, map[string]struct{}{pkg: {}})
+		if err != nil {
+			return nil, err
+		}
+
+		w := workmap[pkg]
+		if want&InternalTestReach != 0 {
+			if err := addTestReach(ex, w.exTest, w.inTest); err != nil {
+				return nil, err
+			}
+		}
+		if want&XTestReach != 0 {
+			if err := addTestReach(ex, w.exXTest, w.inXTest); err != nil {
+				return nil, err
+			}
+		}
+
+		list := make([]string, 0, len(ex))
+		for e := range ex {
+			list = append(list, e)
+		}
+		sort.Strings(list)
+		rm[pkg] = list
+	}
+
+	return rm, nil
+}
+
+// ReachMap pairs a tree's forward reach graph (what does each package
+// reach?) with its transpose, the reverse-reach graph (which packages
+// reach a given external import?). The reverse graph is what lets a
+// solver answer "why is dependency X required?" for user-facing error
+// messages, and lets pruning heuristics quickly find which internal
+// packages go unreachable when a candidate is rejected.
+type ReachMap struct {
+	forward map[string][]string
+	reverse map[string][]string
+	errs    map[string][]PackageError
+}
+
+// newReachMap builds a ReachMap from workmap: the forward graph is
+// exactly what wmToReach computes for the given reach, and the reverse
+// graph is its transpose, built in the same pass by walking each forward
+// edge pkg -> importPath and appending pkg to reverse[importPath]. Each
+// package's non-fatal listing errors are carried over too, so a
+// consumer can tell a complete reach from one computed around a gap.
+func newReachMap(workmap map[string]wm, basedir string, reach ...TestReach) (*ReachMap, error) {
+	forward, err := wmToReach(workmap, basedir, reach...)
+	if err != nil {
+		return nil, err
+	}
+
+	reverse := make(map[string][]string)
+	for pkg, reach := range forward {
+		for _, imp := range reach {
+			reverse[imp] = append(reverse[imp], pkg)
+		}
+	}
+	for imp := range reverse {
+		sort.Strings(reverse[imp])
+	}
+
+	errs := make(map[string][]PackageError)
+	for pkg, w := range workmap {
+		if len(w.errs) > 0 {
+			errs[pkg] = w.errs
+		}
+	}
+
+	return &ReachMap{forward: forward, reverse: reverse, errs: errs}, nil
+}
+
+// Reach returns the external imports reachable from pkg, or nil if pkg
+// isn't present in the map.
+func (rm *ReachMap) Reach(pkg string) []string {
+	return rm.forward[pkg]
+}
+
+// Importers returns the internal packages that reach importPath, or nil
+// if nothing in the tree reaches it.
+func (rm *ReachMap) Importers(importPath string) []string {
+	return rm.reverse[importPath]
+}
+
+// Errors returns the non-fatal listing errors recorded against pkg, if
+// any, so a consumer can decide whether pkg's reach - computed around
+// whatever couldn't be read - is good enough to resolve against, or
+// whether the gap should fail resolution outright.
+func (rm *ReachMap) Errors(pkg string) []PackageError {
+	return rm.errs[pkg]
+}
+
+// Flatten returns the sorted, deduplicated set of every external import
+// reachable from any package in the tree. When includeStdlib is false,
+// imports whose first path element has no dot - and so can't be a
+// fetchable repository root, e.g. "fmt" or "net/http" - are excluded.
+func (rm *ReachMap) Flatten(includeStdlib bool) []string {
+	set := make(map[string]struct{})
+	for _, reach := range rm.forward {
+		for _, imp := range reach {
+			if !includeStdlib && isStdlib(imp) {
+				continue
+			}
+			set[imp] = struct{}{}
+		}
+	}
+	return sortedSet(set)
+}
+
+// validImportPath reports whether path could plausibly be a real Go
+// import path: non-empty, with no ".." path element and no path
+// separator stray at either end. This catches the common ways a
+// hand-edited or generated import goes wrong without attempting to
+// fully replicate the module-path validation rules in cmd/go.
+func validImportPath(path string) bool {
+	if path == "" || path == "." || path == ".." {
+		return false
+	}
+	if strings.HasPrefix(path, "/") || strings.HasSuffix(path, "/") {
+		return false
+	}
+	for _, elem := range strings.Split(path, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// isStdlib reports whether importPath looks like a standard library
+// import - that is, its first path element contains no dot, and so
+// can't be a domain name for a fetchable repository root.
+func isStdlib(importPath string) bool {
+	first := importPath
+	if i := strings.IndexByte(importPath, '/'); i >= 0 {
+		first = importPath[:i]
+	}
+	return !strings.Contains(first, ".")
+}
+
+// wmToReachUnion computes the external reach map for the union of several
+// target tuples in one pass: a package's reach includes an import if any
+// recorded file pulling it in would be built for at least one of the
+// tuples. This is what lets a solver lock in a dependency that's only
+// imported on, say, darwin/arm64, even when the primary analysis target
+// is linux/amd64.
+//
+// Packages in workmap that weren't built with per-file tracking are
+// passed through to wmToReach unchanged.
+func wmToReachUnion(workmap map[string]wm, basedir string, tuples ...AnalysisContext) (map[string][]string, error) {
+	retargeted := make(map[string]wm, len(workmap))
+	for pkg, w := range workmap {
+		rw, err := w.reachForTuples(tuples...)
+		if err != nil {
+			return nil, err
+		}
+		retargeted[pkg] = rw
+	}
+
+	return wmToReach(retargeted, basedir)
+}
+
+// buildWorkmap walks the source tree rooted at root and assembles a
+// workmap - one wm per directory holding Go files, each carrying the
+// per-file fileRoot/files metadata that reachForTuples (and so
+// wmToReachUnion) needs to retarget a package's reach at a different
+// AnalysisContext, or union it across several, without re-parsing. Each
+// file's imports are routed into the production, internal-test, or
+// xtest sets by classifyTestKind, the same split listPackagesCached
+// makes between Imports, TestImports, and XTestImports - so that
+// wmToReach's default, test-free reach leaves out test-only imports the
+// same way listPackages' Imports does. A directory's non-fatal parse/import errors are carried
+// over onto its wm's errs field, for newReachMap to propagate.
+//
+// Build constraints aren't evaluated here: every file in a directory
+// contributes its imports to that directory's wm, the same as
+// parseSourceFiles itself, leaving tuple-specific filtering to whoever
+// later calls reachForTuples or wmToReachUnion on the result. An import
+// is classified "in" - an edge to another package under analysis - if
+// it is importRoot itself or falls under importRoot as a subpackage;
+// every other import is "ex".
+func buildWorkmap(root, importRoot string) (map[string]wm, error) {
+	cache := newParsedFileCache()
+	workmap := make(map[string]wm)
+
+	isInternal := func(imp string) bool {
+		return imp == importRoot || strings.HasPrefix(imp, importRoot+"/")
+	}
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root && skipWalkDir(d.Name()) {
+			return filepath.SkipDir
+		}
+
+		files, errs, err := parseSourceFilesCached(path, cache)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return nil
+		}
+
+		w := wm{
+			ex: make(map[string]struct{}), in: make(map[string]struct{}),
+			exTest: make(map[string]struct{}), inTest: make(map[string]struct{}),
+			exXTest: make(map[string]struct{}), inXTest: make(map[string]struct{}),
+			errs: errs, fileRoot: path,
+		}
+		for _, f := range files {
+			switch classifyTestKind(f) {
+			case xtestFile:
+				for _, imp := range f.imports {
+					if isInternal(imp) {
+						w.inXTest[imp] = struct{}{}
+					} else {
+						w.exXTest[imp] = struct{}{}
+					}
+				}
+			case internalTestFile:
+				for _, imp := range f.imports {
+					if isInternal(imp) {
+						w.inTest[imp] = struct{}{}
+					} else {
+						w.exTest[imp] = struct{}{}
+					}
+				}
+			default:
+				wf := wmFile{name: f.name, isCgo: f.isCgo, ex: make(map[string]struct{}), in: make(map[string]struct{})}
+				for _, imp := range f.imports {
+					if isInternal(imp) {
+						wf.in[imp] = struct{}{}
+						w.in[imp] = struct{}{}
+					} else {
+						wf.ex[imp] = struct{}{}
+						w.ex[imp] = struct{}{}
+					}
+				}
+				w.files = append(w.files, wf)
+			}
+		}
+		workmap[importPathFor(root, importRoot, path)] = w
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return workmap, nil
+}
+
+// sourceFile holds the parsed-import facts for a single .go file, ahead of
+// any build-constraint filtering.
+type sourceFile struct {
+	name       string
+	pkgName    string
+	isTestFile bool // filename ends in _test.go
+	isXTest    bool // package clause ends in _test
+	imports    []string
+
+	// isCgo and cgoPkgConfig hold the cgo-specific facts gathered while
+	// parsing - whether the file imports "C", and, if so, the
+	// pkg-config/LDFLAGS arguments declared in its `#cgo` preamble
+	// directives.
+	isCgo        bool
+	cgoPkgConfig []string
+}
+
+// fileTestKind says whether a sourceFile holds production code, an
+// internal test (same package, compiled only into that package's own
+// test binary), or an xtest (the package's "_test"-suffixed external
+// test package).
+type fileTestKind uint8
+
+const (
+	prodFile fileTestKind = iota
+	internalTestFile
+	xtestFile
+)
+
+// classifyTestKind reports which of imports/TestImports/XTestImports a
+// file's imports belong in, the split listPackagesCached, listPackagesUnion,
+// and buildWorkmap all need to make identically.
+func classifyTestKind(f sourceFile) fileTestKind {
+	switch {
+	case f.isXTest:
+		return xtestFile
+	case f.isTestFile:
+		return internalTestFile
+	default:
+		return prodFile
+	}
+}
+
+// parsedFileEntry is what parsedFileCache memoizes per absolute file
+// path: the file's derived sourceFile facts, plus any PackageErrors
+// produced while parsing or validating it.
+type parsedFileEntry struct {
+	sf   sourceFile
+	errs []PackageError
+}
+
+// parsedFileCache memoizes per-file parse results keyed by absolute
+// path, so that listing the same file more than once - across sibling
+// packages that happen to share a file, or across repeated listings of
+// the same tree for different target tuples - only pays the go/parser
+// cost once. It's safe for concurrent use: ForEachPackage shares one
+// across all the goroutines in a single walk.
+type parsedFileCache struct {
+	mu      sync.Mutex
+	entries map[string]parsedFileEntry
+}
+
+func newParsedFileCache() *parsedFileCache {
+	return &parsedFileCache{entries: make(map[string]parsedFileEntry)}
+}
+
+// parse returns the cached parse of fpath if present, else parses it,
+// caches the result, and returns that. fset is a shared *token.FileSet -
+// safe to use concurrently, per its documentation - used only for
+// reporting error positions.
+func (c *parsedFileCache) parse(fset *token.FileSet, fpath, name string) parsedFileEntry {
+	c.mu.Lock()
+	if e, ok := c.entries[fpath]; ok {
+		c.mu.Unlock()
+		return e
+	}
+	c.mu.Unlock()
+
+	e := parseOneFile(fset, fpath, name)
+
+	c.mu.Lock()
+	c.entries[fpath] = e
+	c.mu.Unlock()
+	return e
+}
+
+// parseOneFile parses a single .go file for its package clause and
+// import list. A parse failure, or a malformed import path, is recorded
+// as a PackageError rather than returned as an error, so a caller
+// harvesting a whole directory can go on past it: a file that fails to
+// parse yields no sourceFile, while a malformed import is left out of
+// an otherwise intact sourceFile's imports.
+func parseOneFile(fset *token.FileSet, fpath, name string) parsedFileEntry {
+	af, err := parser.ParseFile(fset, fpath, nil, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return parsedFileEntry{errs: []PackageError{{Pos: fpath, Kind: ParseError, Msg: err.Error()}}}
+	}
+
+	sf := sourceFile{
+		name:       name,
+		isTestFile: strings.HasSuffix(name, "_test.go"),
+	}
+	sf.pkgName = af.Name.Name
+	sf.isXTest = strings.HasSuffix(sf.pkgName, "_test")
+
+	var errs []PackageError
+	for _, imp := range af.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err == nil && !validImportPath(path) {
+			err = fmt.Errorf("invalid import path %q", path)
+		}
+		if err != nil {
+			errs = append(errs, PackageError{
+				Pos:  fset.Position(imp.Path.Pos()).String(),
+				Kind: ImportError,
+				Msg:  fmt.Sprintf("malformed import path %s: %v", imp.Path.Value, err),
+			})
+			continue
+		}
+		if path == "testing" {
+			continue
+		}
+		if path == "C" {
+			sf.isCgo = true
+			continue
+		}
+		sf.imports = append(sf.imports, path)
+	}
+
+	if sf.isCgo {
+		sf.cgoPkgConfig = cgoPreambleArgs(af)
+	}
+
+	return parsedFileEntry{sf: sf, errs: errs}
+}
+
+// cgoPreambleArgs extracts the arguments declared by `#cgo LDFLAGS: ...`
+// and `#cgo pkg-config: ...` directives in af's comments - the same
+// directives `go build` itself would feed to the external linker and to
+// pkg-config, respectively. Directives restricted to a GOOS/GOARCH tag
+// (e.g. `#cgo linux LDFLAGS: -lrt`) are picked up the same as untagged
+// ones; listPackages doesn't attempt to evaluate that tag, since a
+// solver's only use for this is a conservative "what might this package
+// need" check.
+func cgoPreambleArgs(af *ast.File) []string {
+	var out []string
+	for _, cg := range af.Comments {
+		for _, c := range cg.List {
+			body := strings.TrimSuffix(strings.TrimPrefix(c.Text, "/*"), "*/")
+			body = strings.TrimPrefix(body, "//")
+
+			for _, line := range strings.Split(body, "\n") {
+				line = strings.TrimSpace(strings.TrimPrefix(line, "//"))
+				if !strings.HasPrefix(line, "#cgo ") {
+					continue
+				}
+
+				directive := strings.TrimSpace(strings.TrimPrefix(line, "#cgo"))
+				i := strings.Index(directive, ":")
+				if i < 0 {
+					continue
+				}
+
+				fields := strings.Fields(directive[:i])
+				if len(fields) == 0 {
+					continue
+				}
+				switch fields[len(fields)-1] {
+				case "LDFLAGS", "pkg-config":
+					out = append(out, strings.Fields(directive[i+1:])...)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// parseSourceFiles parses every .go file directly within fileRoot (no
+// recursion into subdirectories) for its package clause and import list,
+// without regard to build constraints - that's left to the caller, so
+// that the parse itself can be reused across multiple target tuples.
+//
+// A file that fails to parse, or that contains a malformed import path,
+// doesn't abort the walk: it's recorded as a PackageError and the rest of
+// the directory is still processed. The returned error is reserved for
+// I/O failures reading fileRoot itself, since there's no partial result
+// to salvage from those.
+func parseSourceFiles(fileRoot string) ([]sourceFile, []PackageError, error) {
+	return parseSourceFilesCached(fileRoot, newParsedFileCache())
+}
+
+// parseSourceFilesCached is parseSourceFiles, but memoizing each file's
+// parse in cache rather than a private one-shot cache - see
+// parsedFileCache.
+func parseSourceFilesCached(fileRoot string, cache *parsedFileCache) ([]sourceFile, []PackageError, error) {
+	entries, err := os.ReadDir(fileRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fset := token.NewFileSet()
+	var files []sourceFile
+	var errs []PackageError
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") {
+			continue
+		}
+
+		fpath := filepath.Join(fileRoot, entry.Name())
+		e := cache.parse(fset, fpath, entry.Name())
+		errs = append(errs, e.errs...)
+		if e.sf.name != "" {
+			files = append(files, e.sf)
+		}
+	}
+
+	return files, errs, nil
+}
+
+// listPackages parses the .go files directly within fileRoot - it does not
+// recurse into subdirectories - and reports the single package they make
+// up under the import path importRoot, as it would be built for ctx.
+//
+// A file is only harvested for its imports if ctx's build context would
+// include it: files excluded by a `// +build` constraint, a negated tag,
+// or a `_GOOS_GOARCH.go`-style filename suffix are skipped entirely, the
+// same as `go build` would skip them. A file that imports "C" is skipped
+// the same way whenever ctx.CgoEnabled is false; when cgo is enabled, its
+// "C" pseudo-import is dropped from Imports and its `#cgo LDFLAGS`/
+// `#cgo pkg-config` preamble directives are folded into CgoPkgConfig
+// instead. Every file excluded for either reason is recorded on
+// IgnoredGoFiles rather than silently dropped.
+//
+// listPackages always returns its best-effort result set; a file that
+// fails to parse or has a malformed import is recorded on the resulting
+// Package's Errors field rather than aborting the walk. The returned
+// error is reserved for I/O failures reading fileRoot itself. If
+// fileRoot has no .go files at all, listPackages returns (nil, nil)
+// rather than an error, so a caller walking many directories can simply
+// skip it. If it has .go files but none of them is harvested - every one
+// excluded or unparseable - the result is a single Package carrying only
+// ImportPath, Errors and IgnoredGoFiles.
+func listPackages(fileRoot, importRoot string, ctx AnalysisContext) ([]Package, error) {
+	return listPackagesCached(fileRoot, importRoot, ctx, newParsedFileCache())
+}
+
+// listPackagesCached is listPackages, but sourcing file parses from
+// cache instead of a private one-shot cache - see parsedFileCache and
+// ForEachPackage.
+func listPackagesCached(fileRoot, importRoot string, ctx AnalysisContext, cache *parsedFileCache) ([]Package, error) {
+	files, errs, err := parseSourceFilesCached(fileRoot, cache)
+	if err != nil {
+		return nil, err
+	}
+
+	bc := ctx.buildContext()
+
+	var pkgName string
+	haveName := false
+	imports := make(map[string]struct{})
+	testImports := make(map[string]struct{})
+	xtestImports := make(map[string]struct{})
+	ignored := make(map[string]struct{})
+	cgoPkgConfig := make(map[string]struct{})
+
+	for _, f := range files {
+		ok, err := bc.MatchFile(fileRoot, f.name)
+		if err != nil {
+			errs = append(errs, PackageError{Pos: filepath.Join(fileRoot, f.name), Kind: ListError, Msg: err.Error()})
+			continue
+		}
+		if !ok || (f.isCgo && !bc.CgoEnabled) {
+			ignored[f.name] = struct{}{}
+			continue
+		}
+
+		basePkgName := strings.TrimSuffix(f.pkgName, "_test")
+		if !haveName {
+			pkgName = basePkgName
+			haveName = true
+		} else if basePkgName != pkgName {
+			errs = append(errs, PackageError{
+				Pos:  filepath.Join(fileRoot, f.name),
+				Kind: ListError,
+				Msg:  fmt.Sprintf("found multiple package names in %q: %q and %q", fileRoot, pkgName, basePkgName),
+			})
+			continue
+		}
+
+		set := imports
+		switch classifyTestKind(f) {
+		case xtestFile:
+			set = xtestImports
+		case internalTestFile:
+			set = testImports
+		}
+		for _, imp := range f.imports {
+			set[imp] = struct{}{}
+		}
+		if f.isCgo {
+			for _, pc := range f.cgoPkgConfig {
+				cgoPkgConfig[pc] = struct{}{}
+			}
+		}
+	}
+
+	if !haveName {
+		if len(errs) == 0 && len(ignored) == 0 {
+			return nil, nil
+		}
+		return []Package{{ImportPath: importRoot, Errors: errs, IgnoredGoFiles: sortedSet(ignored)}}, nil
+	}
+
+	return []Package{{
+		ImportPath:     importRoot,
+		Name:           pkgName,
+		Imports:        sortedSet(imports),
+		TestImports:    sortedSet(testImports),
+		XTestImports:   sortedSet(xtestImports),
+		Errors:         errs,
+		IgnoredGoFiles: sortedSet(ignored),
+		CgoPkgConfig:   sortedSet(cgoPkgConfig),
+	}}, nil
+}
+
+// listPackagesUnion is listPackages' counterpart for callers that need a
+// package's reach across several target tuples at once: a file is
+// harvested if the build context of ANY of tuples would include it,
+// so the result reflects what's reachable on at least one platform in
+// the set (e.g. {linux,amd64}, {darwin,arm64}, {windows,amd64}).
+//
+// The source tree is parsed exactly once regardless of len(tuples).
+func listPackagesUnion(fileRoot, importRoot string, tuples ...AnalysisContext) ([]Package, error) {
+	if len(tuples) == 0 {
+		return nil, fmt.Errorf("listPackagesUnion requires at least one target tuple")
+	}
+
+	files, errs, err := parseSourceFiles(fileRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgName string
+	haveName := false
+	imports := make(map[string]struct{})
+	testImports := make(map[string]struct{})
+	xtestImports := make(map[string]struct{})
+	ignored := make(map[string]struct{})
+	cgoPkgConfig := make(map[string]struct{})
+
+	for _, f := range files {
+		var included bool
+		for _, t := range tuples {
+			bc := t.buildContext()
+			ok, err := bc.MatchFile(fileRoot, f.name)
+			if err != nil {
+				errs = append(errs, PackageError{Pos: filepath.Join(fileRoot, f.name), Kind: ListError, Msg: err.Error()})
+				included = false
+				break
+			}
+			if ok && (!f.isCgo || bc.CgoEnabled) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			ignored[f.name] = struct{}{}
+			continue
+		}
+
+		basePkgName := strings.TrimSuffix(f.pkgName, "_test")
+		if !haveName {
+			pkgName = basePkgName
+			haveName = true
+		} else if basePkgName != pkgName {
+			errs = append(errs, PackageError{
+				Pos:  filepath.Join(fileRoot, f.name),
+				Kind: ListError,
+				Msg:  fmt.Sprintf("found multiple package names in %q: %q and %q", fileRoot, pkgName, basePkgName),
+			})
+			continue
+		}
+
+		set := imports
+		switch classifyTestKind(f) {
+		case xtestFile:
+			set = xtestImports
+		case internalTestFile:
+			set = testImports
+		}
+		for _, imp := range f.imports {
+			set[imp] = struct{}{}
+		}
+		if f.isCgo {
+			for _, pc := range f.cgoPkgConfig {
+				cgoPkgConfig[pc] = struct{}{}
+			}
+		}
+	}
+
+	if !haveName {
+		if len(errs) == 0 && len(ignored) == 0 {
+			return nil, nil
+		}
+		return []Package{{ImportPath: importRoot, Errors: errs, IgnoredGoFiles: sortedSet(ignored)}}, nil
+	}
+
+	return []Package{{
+		ImportPath:     importRoot,
+		Name:           pkgName,
+		Imports:        sortedSet(imports),
+		TestImports:    sortedSet(testImports),
+		XTestImports:   sortedSet(xtestImports),
+		Errors:         errs,
+		IgnoredGoFiles: sortedSet(ignored),
+		CgoPkgConfig:   sortedSet(cgoPkgConfig),
+	}}, nil
+}
+
+// sortedSet renders a set of strings as a sorted slice, or nil if the set
+// is empty, so that callers comparing against a literal zero-value slice
+// don't have to special-case the empty set.
+func sortedSet(set map[string]struct{}) []string {
+	if len(set) == 0 {
+		return nil
+	}
+
+	out := make([]string, 0, len(set))
+	for s := range set {
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// skipWalkDir is the set of directory name patterns ForEachPackage never
+// descends into - the same ones `go build` itself ignores.
+func skipWalkDir(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata"
+}
+
+// ForEachPackage walks the source tree rooted at root - every directory
+// skipWalkDir doesn't exclude, not just the ones holding buildable Go
+// files - and invokes fn once for every package it finds, in arbitrary
+// order, with the import path it was given relative to importRoot and
+// either the listed Package or the error encountered listing it.
+// Directories with no .go files produce no call at all, matching
+// listPackages; a directory whose .go files are all excluded or broken
+// still gets a call, with the Package listPackages reports for it.
+//
+// One goroutine lists each directory, bounded to GOMAXPROCS at a time,
+// so a single slow or huge package doesn't stall the rest of the walk.
+// All directories share a parsedFileCache, so a file that's read more
+// than once - a sibling package's copy, or the same tree listed again
+// for a different AnalysisContext - is only parsed once. fn is called
+// from whichever goroutine finishes first; if it panics, ForEachPackage
+// recovers and reports the panic as that directory's error rather than
+// taking down the walk or leaking the goroutine.
+//
+// ForEachPackage blocks until every directory has been listed.
+func ForEachPackage(root, importRoot string, fn func(importPath string, pkg Package, err error)) {
+	cache := newParsedFileCache()
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	var wg sync.WaitGroup
+
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			func() {
+				defer func() { recover() }()
+				fn(importPathFor(root, importRoot, path), Package{}, err)
+			}()
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root && skipWalkDir(d.Name()) {
+			return filepath.SkipDir
+		}
+
+		dir, ip := path, importPathFor(root, importRoot, path)
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			defer func() {
+				if r := recover(); r != nil {
+					// fn itself just panicked; guard this notification
+					// call too, so a callback that panics deterministically
+					// for this directory can't re-panic on the way out.
+					defer func() { recover() }()
+					fn(ip, Package{}, fmt.Errorf("panic listing %s: %v", dir, r))
+				}
+			}()
+
+			pkgs, err := listPackagesCached(dir, ip, AnalysisContext{}, cache)
+			if err != nil {
+				fn(ip, Package{}, err)
+				return
+			}
+			for _, pkg := range pkgs {
+				fn(ip, pkg, nil)
+			}
+		}()
+
+		return nil
+	})
+
+	wg.Wait()
+}
+
+// importPathFor derives dir's import path by replacing root with
+// importRoot in its place, the same rule listPackages' callers use for a
+// single directory, generalized to every directory under root.
+func importPathFor(root, importRoot, dir string) string {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return importRoot
+	}
+	return importRoot + "/" + filepath.ToSlash(rel)
+}
+
+// ListAllPackages is ForEachPackage's convenience form for callers who
+// just want every package in the tree back as a slice, sorted by import
+// path, with a combined error if any directory failed to list.
+func ListAllPackages(root, importRoot string) ([]Package, error) {
+	var mu sync.Mutex
+	var pkgs []Package
+	var errs []error
+
+	ForEachPackage(root, importRoot, func(importPath string, pkg Package, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", importPath, err))
+			return
+		}
+		pkgs = append(pkgs, pkg)
+	})
+
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].ImportPath < pkgs[j].ImportPath })
+
+	if len(errs) > 0 {
+		return pkgs, fmt.Errorf("%d package(s) failed to list: %v", len(errs), errs[0])
+	}
+	return pkgs, nil
+}
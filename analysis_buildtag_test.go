@@ -0,0 +1,184 @@
+package vsolver
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestListPackagesBuildTags exercises listPackages' build-constraint
+// awareness against _testdata/src/buildtags, a fixture with a plain file,
+// a `+build linux` file, a negated `+build !windows` file, a multi-term
+// `+build darwin,arm64 linux,amd64` file, a `_windows_amd64.go` filename
+// suffix, and a `+build linux` test file.
+func TestListPackagesBuildTags(t *testing.T) {
+	srcdir := filepath.Join(getwd(t), "_testdata", "src", "buildtags")
+
+	table := map[string]struct {
+		ctx         AnalysisContext
+		imports     []string
+		testImports []string
+		ignored     []string
+	}{
+		"linux/amd64": {
+			ctx:         AnalysisContext{GOOS: "linux", GOARCH: "amd64"},
+			imports:     []string{"crypto/sha256", "fmt", "os/user", "syscall"},
+			testImports: []string{"strconv"},
+			ignored:     []string{"foo_windows_amd64.go"},
+		},
+		"darwin/arm64": {
+			ctx:     AnalysisContext{GOOS: "darwin", GOARCH: "arm64"},
+			imports: []string{"crypto/sha256", "fmt", "os/user"},
+			ignored: []string{"foo_test.go", "foo_windows_amd64.go", "linux_only.go"},
+		},
+		"windows/amd64": {
+			ctx:     AnalysisContext{GOOS: "windows", GOARCH: "amd64"},
+			imports: []string{"crypto/md5", "fmt"},
+			ignored: []string{"foo_test.go", "linux_only.go", "multi_tag.go", "neg_tag.go"},
+		},
+	}
+
+	for name, fix := range table {
+		out, err := listPackages(srcdir, "buildtags", fix.ctx)
+		if err != nil {
+			t.Errorf("listPackages(%q): %v", name, err)
+			continue
+		}
+
+		want := []Package{{
+			ImportPath:     "buildtags",
+			Name:           "buildtags",
+			Imports:        fix.imports,
+			TestImports:    fix.testImports,
+			IgnoredGoFiles: fix.ignored,
+		}}
+
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("listPackages(%q): Did not get expected package set:\n\t(GOT): %s\n\t(WNT): %s", name, out, want)
+		}
+	}
+}
+
+// TestListPackagesUnion checks that listPackagesUnion reports the set of
+// imports reachable on AT LEAST ONE of several target tuples, parsing the
+// tree only once.
+func TestListPackagesUnion(t *testing.T) {
+	srcdir := filepath.Join(getwd(t), "_testdata", "src", "buildtags")
+
+	tuples := []AnalysisContext{
+		{GOOS: "linux", GOARCH: "amd64"},
+		{GOOS: "darwin", GOARCH: "arm64"},
+		{GOOS: "windows", GOARCH: "amd64"},
+	}
+
+	out, err := listPackagesUnion(srcdir, "buildtags", tuples...)
+	if err != nil {
+		t.Fatalf("listPackagesUnion: %v", err)
+	}
+
+	want := []Package{{
+		ImportPath:  "buildtags",
+		Name:        "buildtags",
+		Imports:     []string{"crypto/md5", "crypto/sha256", "fmt", "os/user", "syscall"},
+		TestImports: []string{"strconv"},
+	}}
+
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("listPackagesUnion: Did not get expected package set:\n\t(GOT): %s\n\t(WNT): %s", out, want)
+	}
+}
+
+// TestWMReachForTuples checks that a workmap entry built with per-file
+// tracking can be retargeted at a different tuple, or unioned across
+// several, by re-checking each file's recorded build constraint rather
+// than re-parsing the tree.
+func TestWMReachForTuples(t *testing.T) {
+	srcdir := filepath.Join(getwd(t), "_testdata", "src", "buildtags")
+
+	w := wm{
+		ex: map[string]struct{}{},
+		in: map[string]struct{}{},
+
+		fileRoot: srcdir,
+		files: []wmFile{
+			{name: "plain.go", ex: map[string]struct{}{"fmt": {}}},
+			{name: "linux_only.go", ex: map[string]struct{}{"syscall": {}}},
+			{name: "neg_tag.go", ex: map[string]struct{}{"os/user": {}}},
+			{name: "multi_tag.go", ex: map[string]struct{}{"crypto/sha256": {}}},
+			{name: "foo_windows_amd64.go", ex: map[string]struct{}{"crypto/md5": {}}},
+		},
+	}
+
+	linux, err := w.reachForTuples(AnalysisContext{GOOS: "linux", GOARCH: "amd64"})
+	if err != nil {
+		t.Fatalf("reachForTuples(linux/amd64): %v", err)
+	}
+	wantLinux := map[string]struct{}{"fmt": {}, "syscall": {}, "os/user": {}, "crypto/sha256": {}}
+	if !reflect.DeepEqual(linux.ex, wantLinux) {
+		t.Errorf("reachForTuples(linux/amd64): got %v, want %v", linux.ex, wantLinux)
+	}
+
+	windows, err := w.reachForTuples(AnalysisContext{GOOS: "windows", GOARCH: "amd64"})
+	if err != nil {
+		t.Fatalf("reachForTuples(windows/amd64): %v", err)
+	}
+	wantWindows := map[string]struct{}{"fmt": {}, "crypto/md5": {}}
+	if !reflect.DeepEqual(windows.ex, wantWindows) {
+		t.Errorf("reachForTuples(windows/amd64): got %v, want %v", windows.ex, wantWindows)
+	}
+
+	union, err := w.reachForTuples(
+		AnalysisContext{GOOS: "linux", GOARCH: "amd64"},
+		AnalysisContext{GOOS: "windows", GOARCH: "amd64"},
+	)
+	if err != nil {
+		t.Fatalf("reachForTuples(union): %v", err)
+	}
+	wantUnion := map[string]struct{}{
+		"fmt": {}, "syscall": {}, "os/user": {}, "crypto/sha256": {}, "crypto/md5": {},
+	}
+	if !reflect.DeepEqual(union.ex, wantUnion) {
+		t.Errorf("reachForTuples(union): got %v, want %v", union.ex, wantUnion)
+	}
+}
+
+// TestWmToReachUnionRealTree exercises buildWorkmap and wmToReachUnion
+// end to end against _testdata/src/uniontree, a two-package tree where
+// "uniontree/top" imports "uniontree/base" internally, plus one
+// linux-only file and one file excluded on every OS but windows/amd64
+// by its filename suffix.
+func TestWmToReachUnionRealTree(t *testing.T) {
+	root := filepath.Join(getwd(t), "_testdata", "src", "uniontree")
+
+	workmap, err := buildWorkmap(root, "uniontree")
+	if err != nil {
+		t.Fatalf("buildWorkmap: %v", err)
+	}
+
+	linux := AnalysisContext{GOOS: "linux", GOARCH: "amd64"}
+	windows := AnalysisContext{GOOS: "windows", GOARCH: "amd64"}
+
+	union, err := wmToReachUnion(workmap, root, linux, windows)
+	if err != nil {
+		t.Fatalf("wmToReachUnion: %v", err)
+	}
+
+	wantBase := []string{"fmt"}
+	if got := union["uniontree/base"]; !reflect.DeepEqual(got, wantBase) {
+		t.Errorf("wmToReachUnion: reach(uniontree/base) = %v, want %v", got, wantBase)
+	}
+
+	wantTop := []string{"crypto/md5", "fmt", "sort", "syscall"}
+	if got := union["uniontree/top"]; !reflect.DeepEqual(got, wantTop) {
+		t.Errorf("wmToReachUnion: reach(uniontree/top) = %v, want %v", got, wantTop)
+	}
+
+	linuxOnly, err := wmToReachUnion(workmap, root, linux)
+	if err != nil {
+		t.Fatalf("wmToReachUnion(linux only): %v", err)
+	}
+	wantLinuxTop := []string{"fmt", "sort", "syscall"}
+	if got := linuxOnly["uniontree/top"]; !reflect.DeepEqual(got, wantLinuxTop) {
+		t.Errorf("wmToReachUnion(linux only): reach(uniontree/top) = %v, want %v", got, wantLinuxTop)
+	}
+}
@@ -0,0 +1,162 @@
+package vsolver
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestListPackagesCgo exercises listPackages' cgo handling against
+// _testdata/src/cgopkg, a single-file package whose only file imports
+// "C" and declares `#cgo LDFLAGS`/`#cgo pkg-config` preamble directives.
+func TestListPackagesCgo(t *testing.T) {
+	srcdir := filepath.Join(getwd(t), "_testdata", "src", "cgopkg")
+
+	out, err := listPackages(srcdir, "cgopkg", AnalysisContext{CgoEnabled: true})
+	if err != nil {
+		t.Fatalf("listPackages(cgo enabled): %v", err)
+	}
+	want := []Package{{
+		ImportPath:   "cgopkg",
+		Name:         "cgopkg",
+		Imports:      []string{"fmt"},
+		CgoPkgConfig: []string{"-lm", "zlib"},
+	}}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("listPackages(cgo enabled):\n\t(GOT): %s\n\t(WNT): %s", out, want)
+	}
+
+	out, err = listPackages(srcdir, "cgopkg", AnalysisContext{CgoEnabled: false})
+	if err != nil {
+		t.Fatalf("listPackages(cgo disabled): %v", err)
+	}
+	want = []Package{{
+		ImportPath:     "cgopkg",
+		Errors:         nil,
+		IgnoredGoFiles: []string{"cgopkg.go"},
+	}}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("listPackages(cgo disabled):\n\t(GOT): %s\n\t(WNT): %s", out, want)
+	}
+}
+
+// TestListPackagesCgoBlockComment checks that a `/* ... */`-style cgo
+// preamble is split into its individual `#cgo` directive lines before
+// they're matched, the same as a run of `//` lines would be - a single
+// multi-line block comment must not let one directive's value bleed
+// into the next, or swallow an unrelated `#include` line.
+func TestListPackagesCgoBlockComment(t *testing.T) {
+	srcdir := filepath.Join(getwd(t), "_testdata", "src", "cgoblock")
+
+	out, err := listPackages(srcdir, "cgoblock", AnalysisContext{CgoEnabled: true})
+	if err != nil {
+		t.Fatalf("listPackages: %v", err)
+	}
+	want := []Package{{
+		ImportPath:   "cgoblock",
+		Name:         "cgoblock",
+		Imports:      []string{"fmt"},
+		CgoPkgConfig: []string{"-lm", "zlib"},
+	}}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("listPackages:\n\t(GOT): %s\n\t(WNT): %s", out, want)
+	}
+}
+
+// TestListPackagesIgnoredBuildTag checks that a directory whose only Go
+// file is excluded by a filename-suffix build constraint reports that
+// file on IgnoredGoFiles rather than being indistinguishable from an
+// empty directory.
+func TestListPackagesIgnoredBuildTag(t *testing.T) {
+	srcdir := filepath.Join(getwd(t), "_testdata", "src", "excludedonly")
+
+	out, err := listPackages(srcdir, "excludedonly", AnalysisContext{GOOS: "linux", GOARCH: "amd64"})
+	if err != nil {
+		t.Fatalf("listPackages: %v", err)
+	}
+	want := []Package{{
+		ImportPath:     "excludedonly",
+		IgnoredGoFiles: []string{"code_plan9.go"},
+	}}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("listPackages:\n\t(GOT): %s\n\t(WNT): %s", out, want)
+	}
+}
+
+// TestListPackagesMixedCgo checks a package with both a pure-Go file and
+// a cgo file: with cgo disabled, the pure-Go file alone makes up the
+// package and the cgo file is reported as ignored; with cgo enabled,
+// both contribute to Imports and the cgo file's preamble directive
+// lands in CgoPkgConfig.
+func TestListPackagesMixedCgo(t *testing.T) {
+	srcdir := filepath.Join(getwd(t), "_testdata", "src", "mixedcgo")
+
+	out, err := listPackages(srcdir, "mixedcgo", AnalysisContext{CgoEnabled: false})
+	if err != nil {
+		t.Fatalf("listPackages(cgo disabled): %v", err)
+	}
+	want := []Package{{
+		ImportPath:     "mixedcgo",
+		Name:           "mixedcgo",
+		Imports:        []string{"strings"},
+		IgnoredGoFiles: []string{"native.go"},
+	}}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("listPackages(cgo disabled):\n\t(GOT): %s\n\t(WNT): %s", out, want)
+	}
+
+	out, err = listPackages(srcdir, "mixedcgo", AnalysisContext{CgoEnabled: true})
+	if err != nil {
+		t.Fatalf("listPackages(cgo enabled): %v", err)
+	}
+	want = []Package{{
+		ImportPath:   "mixedcgo",
+		Name:         "mixedcgo",
+		Imports:      []string{"fmt", "strings"},
+		CgoPkgConfig: []string{"-lpthread"},
+	}}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("listPackages(cgo enabled):\n\t(GOT): %s\n\t(WNT): %s", out, want)
+	}
+}
+
+// TestWmToReachUnionCgoGating exercises buildWorkmap and wmToReachUnion
+// against _testdata/src/mixedcgo end to end, checking that a real-tree
+// wm's per-file isCgo tag makes reachForTuples gate native.go's "fmt"
+// import on CgoEnabled the same way listPackages does, instead of
+// leaking it into the union reach for every tuple regardless of cgo.
+func TestWmToReachUnionCgoGating(t *testing.T) {
+	root := filepath.Join(getwd(t), "_testdata", "src", "mixedcgo")
+
+	workmap, err := buildWorkmap(root, "mixedcgo")
+	if err != nil {
+		t.Fatalf("buildWorkmap: %v", err)
+	}
+
+	noCgo, err := wmToReachUnion(workmap, root, AnalysisContext{CgoEnabled: false})
+	if err != nil {
+		t.Fatalf("wmToReachUnion(cgo disabled): %v", err)
+	}
+	wantNoCgo := []string{"strings"}
+	if got := noCgo["mixedcgo"]; !reflect.DeepEqual(got, wantNoCgo) {
+		t.Errorf("wmToReachUnion(cgo disabled): reach(mixedcgo) = %v, want %v", got, wantNoCgo)
+	}
+
+	withCgo, err := wmToReachUnion(workmap, root, AnalysisContext{CgoEnabled: true})
+	if err != nil {
+		t.Fatalf("wmToReachUnion(cgo enabled): %v", err)
+	}
+	wantWithCgo := []string{"fmt", "strings"}
+	if got := withCgo["mixedcgo"]; !reflect.DeepEqual(got, wantWithCgo) {
+		t.Errorf("wmToReachUnion(cgo enabled): reach(mixedcgo) = %v, want %v", got, wantWithCgo)
+	}
+
+	union, err := wmToReachUnion(workmap, root,
+		AnalysisContext{CgoEnabled: false}, AnalysisContext{CgoEnabled: true})
+	if err != nil {
+		t.Fatalf("wmToReachUnion(union): %v", err)
+	}
+	if got := union["mixedcgo"]; !reflect.DeepEqual(got, wantWithCgo) {
+		t.Errorf("wmToReachUnion(union): reach(mixedcgo) = %v, want %v", got, wantWithCgo)
+	}
+}
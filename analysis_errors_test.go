@@ -0,0 +1,117 @@
+package vsolver
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestListPackagesPartialErrors checks that a syntax-broken file and a
+// file with a malformed import path each contribute a PackageError
+// without preventing the rest of the directory - including the broken
+// files' own valid neighbors - from being harvested.
+func TestListPackagesPartialErrors(t *testing.T) {
+	srcdir := filepath.Join(getwd(t), "_testdata", "src", "brokenpkg")
+
+	out, err := listPackages(srcdir, "brokenpkg", AnalysisContext{})
+	if err != nil {
+		t.Fatalf("listPackages: %v", err)
+	}
+	if len(out) != 1 {
+		t.Fatalf("listPackages: got %d packages, want 1", len(out))
+	}
+
+	pkg := out[0]
+	if pkg.Name != "brokenpkg" {
+		t.Errorf("Name = %q, want %q", pkg.Name, "brokenpkg")
+	}
+
+	wantImports := []string{"fmt"}
+	if len(pkg.Imports) != len(wantImports) || pkg.Imports[0] != wantImports[0] {
+		t.Errorf("Imports = %v, want %v", pkg.Imports, wantImports)
+	}
+
+	if len(pkg.Errors) != 2 {
+		t.Fatalf("Errors = %v, want 2 entries (one ParseError, one ImportError)", pkg.Errors)
+	}
+
+	var sawParse, sawImport bool
+	for _, e := range pkg.Errors {
+		switch e.Kind {
+		case ParseError:
+			sawParse = true
+		case ImportError:
+			sawImport = true
+		default:
+			t.Errorf("unexpected PackageError kind %q: %v", e.Kind, e)
+		}
+	}
+	if !sawParse {
+		t.Errorf("expected a ParseError among %v", pkg.Errors)
+	}
+	if !sawImport {
+		t.Errorf("expected an ImportError among %v", pkg.Errors)
+	}
+}
+
+// TestBuildWorkmapErrors exercises buildWorkmap against
+// _testdata/src/brokenpkg end to end, checking that the same ParseError
+// and ImportError listPackages reports for this fixture survive into a
+// real-tree wm's errs field, and from there into newReachMap's
+// ReachMap.Errors - not just into a hand-built wm{errs: ...} literal.
+func TestBuildWorkmapErrors(t *testing.T) {
+	root := filepath.Join(getwd(t), "_testdata", "src", "brokenpkg")
+
+	workmap, err := buildWorkmap(root, "brokenpkg")
+	if err != nil {
+		t.Fatalf("buildWorkmap: %v", err)
+	}
+
+	rm, err := newReachMap(workmap, root)
+	if err != nil {
+		t.Fatalf("newReachMap: %v", err)
+	}
+
+	errs := rm.Errors("brokenpkg")
+	if len(errs) != 2 {
+		t.Fatalf("Errors(brokenpkg) = %v, want 2 entries (one ParseError, one ImportError)", errs)
+	}
+
+	var sawParse, sawImport bool
+	for _, e := range errs {
+		switch e.Kind {
+		case ParseError:
+			sawParse = true
+		case ImportError:
+			sawImport = true
+		default:
+			t.Errorf("unexpected PackageError kind %q: %v", e.Kind, e)
+		}
+	}
+	if !sawParse {
+		t.Errorf("expected a ParseError among %v", errs)
+	}
+	if !sawImport {
+		t.Errorf("expected an ImportError among %v", errs)
+	}
+
+	wantReach := []string{"fmt"}
+	if got := rm.Reach("brokenpkg"); !reflect.DeepEqual(got, wantReach) {
+		t.Errorf("Reach(brokenpkg) = %v, want %v", got, wantReach)
+	}
+}
+
+// TestListPackagesEmptyDir checks that a directory with no .go files
+// produces no package and no error, so a caller walking many
+// directories can simply skip it rather than aborting.
+func TestListPackagesEmptyDir(t *testing.T) {
+	srcdir := filepath.Join(getwd(t), "_testdata", "src", "emptydir")
+
+	out, err := listPackages(srcdir, "emptydir", AnalysisContext{})
+	if err != nil {
+		t.Fatalf("listPackages: %v", err)
+	}
+	if out != nil {
+		t.Errorf("listPackages(emptydir) = %v, want nil", out)
+	}
+}
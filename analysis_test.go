@@ -171,7 +171,7 @@ func TestListPackages(t *testing.T) {
 					ImportPath:  "simple",
 					CommentPath: "",
 					Name:        "simple",
-					TestImports: []string{
+					XTestImports: []string{
 						"sort",
 						"strconv",
 					},
@@ -211,7 +211,7 @@ func TestListPackages(t *testing.T) {
 						"github.com/sdboyer/vsolver",
 						"sort",
 					},
-					TestImports: []string{
+					XTestImports: []string{
 						"sort",
 						"strconv",
 					},
@@ -233,6 +233,8 @@ func TestListPackages(t *testing.T) {
 					},
 					TestImports: []string{
 						"math/rand",
+					},
+					XTestImports: []string{
 						"sort",
 						"strconv",
 					},
@@ -247,7 +249,7 @@ func TestListPackages(t *testing.T) {
 			continue
 		}
 
-		out, err := listPackages(fix.fileRoot, fix.importRoot)
+		out, err := listPackages(fix.fileRoot, fix.importRoot, AnalysisContext{})
 
 		if fix.out == nil {
 			if err == nil {
@@ -0,0 +1,142 @@
+package vsolver
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestListPackagesXTestSplit checks that a package importing one thing in
+// its code, a second only in an internal "_test.go" file, and a third
+// only in an external "foo_test" file ends up with three disjoint sets:
+// Imports, TestImports, and XTestImports.
+func TestListPackagesXTestSplit(t *testing.T) {
+	srcdir := filepath.Join(getwd(t), "_testdata", "src", "xyzsplit")
+
+	out, err := listPackages(srcdir, "xyzsplit", AnalysisContext{})
+	if err != nil {
+		t.Fatalf("listPackages: %v", err)
+	}
+
+	want := []Package{{
+		ImportPath:   "xyzsplit",
+		Name:         "xyzsplit",
+		Imports:      []string{"encoding/json"},
+		TestImports:  []string{"errors"},
+		XTestImports: []string{"bufio"},
+	}}
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("listPackages:\n\t(GOT): %s\n\t(WNT): %s", out, want)
+	}
+
+	pkg := out[0]
+	sets := map[string][]string{
+		"Imports":      pkg.Imports,
+		"TestImports":  pkg.TestImports,
+		"XTestImports": pkg.XTestImports,
+	}
+	seen := make(map[string]string)
+	for setName, set := range sets {
+		for _, imp := range set {
+			if prev, ok := seen[imp]; ok {
+				t.Errorf("%q appears in both %s and %s, want disjoint sets", imp, prev, setName)
+			}
+			seen[imp] = setName
+		}
+	}
+}
+
+// TestWMToReachTestOptions checks that wmToReach's TestReach argument
+// independently controls whether a package's internal and external
+// test-only imports contribute to its external reach.
+func TestWMToReachTestOptions(t *testing.T) {
+	workmap := map[string]wm{
+		"foo": {
+			ex:      map[string]struct{}{"prod": {}},
+			in:      map[string]struct{}{},
+			exTest:  map[string]struct{}{"intTest": {}},
+			inTest:  map[string]struct{}{},
+			exXTest: map[string]struct{}{"xtest": {}},
+			inXTest: map[string]struct{}{},
+		},
+	}
+
+	none, err := wmToReach(workmap, "")
+	if err != nil {
+		t.Fatalf("wmToReach(none): %v", err)
+	}
+	if want := []string{"prod"}; !reflect.DeepEqual(none["foo"], want) {
+		t.Errorf("wmToReach(none) = %v, want %v", none["foo"], want)
+	}
+
+	internal, err := wmToReach(workmap, "", InternalTestReach)
+	if err != nil {
+		t.Fatalf("wmToReach(InternalTestReach): %v", err)
+	}
+	if want := []string{"intTest", "prod"}; !reflect.DeepEqual(internal["foo"], want) {
+		t.Errorf("wmToReach(InternalTestReach) = %v, want %v", internal["foo"], want)
+	}
+
+	xtest, err := wmToReach(workmap, "", XTestReach)
+	if err != nil {
+		t.Fatalf("wmToReach(XTestReach): %v", err)
+	}
+	if want := []string{"prod", "xtest"}; !reflect.DeepEqual(xtest["foo"], want) {
+		t.Errorf("wmToReach(XTestReach) = %v, want %v", xtest["foo"], want)
+	}
+
+	both, err := wmToReach(workmap, "", InternalTestReach|XTestReach)
+	if err != nil {
+		t.Fatalf("wmToReach(both): %v", err)
+	}
+	if want := []string{"intTest", "prod", "xtest"}; !reflect.DeepEqual(both["foo"], want) {
+		t.Errorf("wmToReach(both) = %v, want %v", both["foo"], want)
+	}
+}
+
+// TestBuildWorkmapXTestSplit exercises buildWorkmap against
+// _testdata/src/xyzsplit end to end, checking that its real-tree wm keeps
+// production, internal-test, and xtest imports in the same three disjoint
+// sets listPackages itself reports, so wmToReach's default, test-free
+// reach doesn't leak _test.go/xtest imports the way TestListPackagesXTestSplit
+// guards against for listPackages.
+func TestBuildWorkmapXTestSplit(t *testing.T) {
+	root := filepath.Join(getwd(t), "_testdata", "src", "xyzsplit")
+
+	workmap, err := buildWorkmap(root, "xyzsplit")
+	if err != nil {
+		t.Fatalf("buildWorkmap: %v", err)
+	}
+
+	none, err := wmToReach(workmap, root)
+	if err != nil {
+		t.Fatalf("wmToReach(none): %v", err)
+	}
+	if want := []string{"encoding/json"}; !reflect.DeepEqual(none["xyzsplit"], want) {
+		t.Errorf("wmToReach(none) = %v, want %v", none["xyzsplit"], want)
+	}
+
+	internal, err := wmToReach(workmap, root, InternalTestReach)
+	if err != nil {
+		t.Fatalf("wmToReach(InternalTestReach): %v", err)
+	}
+	if want := []string{"encoding/json", "errors"}; !reflect.DeepEqual(internal["xyzsplit"], want) {
+		t.Errorf("wmToReach(InternalTestReach) = %v, want %v", internal["xyzsplit"], want)
+	}
+
+	xtest, err := wmToReach(workmap, root, XTestReach)
+	if err != nil {
+		t.Fatalf("wmToReach(XTestReach): %v", err)
+	}
+	if want := []string{"bufio", "encoding/json"}; !reflect.DeepEqual(xtest["xyzsplit"], want) {
+		t.Errorf("wmToReach(XTestReach) = %v, want %v", xtest["xyzsplit"], want)
+	}
+
+	both, err := wmToReach(workmap, root, InternalTestReach|XTestReach)
+	if err != nil {
+		t.Fatalf("wmToReach(both): %v", err)
+	}
+	if want := []string{"bufio", "encoding/json", "errors"}; !reflect.DeepEqual(both["xyzsplit"], want) {
+		t.Errorf("wmToReach(both) = %v, want %v", both["xyzsplit"], want)
+	}
+}
@@ -0,0 +1,146 @@
+package vsolver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// TestForEachPackage walks _testdata/src - which already holds one
+// directory per fixture package used by this package's other tests -
+// and checks that each of a fixed list of directories with buildable Go
+// files is visited exactly once, while the Go-file-free emptydir
+// fixture produces no callback at all.
+func TestForEachPackage(t *testing.T) {
+	root := filepath.Join(getwd(t), "_testdata", "src")
+
+	var mu sync.Mutex
+	seen := make(map[string]int)
+
+	ForEachPackage(root, "root", func(importPath string, pkg Package, err error) {
+		if err != nil {
+			t.Errorf("ForEachPackage(%q): %v", importPath, err)
+			return
+		}
+		mu.Lock()
+		seen[importPath]++
+		mu.Unlock()
+	})
+
+	want := []string{
+		"root/brokenpkg",
+		"root/buildtags",
+		"root/simple",
+		"root/simpleallt",
+		"root/simplet",
+		"root/simplext",
+		"root/t",
+		"root/xt",
+	}
+	for _, ip := range want {
+		if seen[ip] != 1 {
+			t.Errorf("ForEachPackage: saw %q %d times, want 1", ip, seen[ip])
+		}
+	}
+	if _, ok := seen["root/emptydir"]; ok {
+		t.Errorf("ForEachPackage: emptydir (no Go files) should not have been reported")
+	}
+}
+
+// TestForEachPackagePanicIsolated checks that a panic inside the
+// callback neither crashes the walk nor leaves other directories
+// unvisited.
+func TestForEachPackagePanicIsolated(t *testing.T) {
+	root := filepath.Join(getwd(t), "_testdata", "src")
+
+	var mu sync.Mutex
+	var others int
+
+	ForEachPackage(root, "root", func(importPath string, pkg Package, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if importPath == "root/simple" {
+			panic("boom")
+		}
+		if err != nil && importPath != "root/brokenpkg" {
+			t.Errorf("unexpected error for %q: %v", importPath, err)
+		}
+		others++
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if others == 0 {
+		t.Errorf("other directories should still have been visited after the panic")
+	}
+}
+
+// TestListAllPackages checks ListAllPackages' convenience wrapper:
+// results sorted by import path, covering the same tree as
+// TestForEachPackage.
+func TestListAllPackages(t *testing.T) {
+	root := filepath.Join(getwd(t), "_testdata", "src")
+
+	pkgs, err := ListAllPackages(root, "root")
+	if err != nil {
+		t.Fatalf("ListAllPackages: %v", err)
+	}
+
+	for i := 1; i < len(pkgs); i++ {
+		if pkgs[i-1].ImportPath >= pkgs[i].ImportPath {
+			t.Errorf("ListAllPackages: not sorted at %d: %q >= %q", i, pkgs[i-1].ImportPath, pkgs[i].ImportPath)
+		}
+	}
+
+	var gotSimple bool
+	for _, pkg := range pkgs {
+		if pkg.ImportPath == "root/simple" {
+			gotSimple = true
+		}
+	}
+	if !gotSimple {
+		t.Errorf("ListAllPackages: missing root/simple in %v", pkgs)
+	}
+}
+
+// BenchmarkForEachPackage measures ForEachPackage's concurrent walk over
+// a synthetic tree of N packages with M files each.
+func BenchmarkForEachPackage(b *testing.B) {
+	root := b.TempDir()
+
+	const n, m = 50, 5
+	for i := 0; i < n; i++ {
+		dir := filepath.Join(root, "pkg"+strconv.Itoa(i))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < m; j++ {
+			src := fmt.Sprintf("package pkg%d\n\nimport \"fmt\"\n\nvar _%d = fmt.Sprintf\n", i, j)
+			fname := filepath.Join(dir, "f"+strconv.Itoa(j)+".go")
+			if err := os.WriteFile(fname, []byte(src), 0o644); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var count int
+		var mu sync.Mutex
+		ForEachPackage(root, "synthetic", func(importPath string, pkg Package, err error) {
+			if err != nil {
+				b.Errorf("%s: %v", importPath, err)
+				return
+			}
+			mu.Lock()
+			count++
+			mu.Unlock()
+		})
+		if count != n {
+			b.Fatalf("got %d packages, want %d", count, n)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package vsolver
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestReachMap checks that newReachMap's forward graph matches wmToReach,
+// and that its reverse graph and Flatten correctly transpose and
+// flatten it.
+func TestReachMap(t *testing.T) {
+	workmap := map[string]wm{
+		"foo": {
+			ex: map[string]struct{}{},
+			in: map[string]struct{}{"foo/bar": {}},
+		},
+		"foo/bar": {
+			ex: map[string]struct{}{"baz": {}, "github.com/a/b": {}},
+			in: map[string]struct{}{},
+		},
+		"foo/quux": {
+			ex: map[string]struct{}{"baz": {}},
+			in: map[string]struct{}{},
+		},
+	}
+
+	rm, err := newReachMap(workmap, "")
+	if err != nil {
+		t.Fatalf("newReachMap: %v", err)
+	}
+
+	wantReach := map[string][]string{
+		"foo":      {"baz", "github.com/a/b"},
+		"foo/bar":  {"baz", "github.com/a/b"},
+		"foo/quux": {"baz"},
+	}
+	for pkg, want := range wantReach {
+		if got := rm.Reach(pkg); !reflect.DeepEqual(got, want) {
+			t.Errorf("Reach(%q) = %v, want %v", pkg, got, want)
+		}
+	}
+
+	wantImporters := map[string][]string{
+		"baz":            {"foo", "foo/bar", "foo/quux"},
+		"github.com/a/b": {"foo", "foo/bar"},
+	}
+	for imp, want := range wantImporters {
+		if got := rm.Importers(imp); !reflect.DeepEqual(got, want) {
+			t.Errorf("Importers(%q) = %v, want %v", imp, got, want)
+		}
+	}
+
+	if got := rm.Importers("nobody/imports/this"); got != nil {
+		t.Errorf("Importers(unreached) = %v, want nil", got)
+	}
+
+	wantFlatNoStdlib := []string{"github.com/a/b"}
+	if got := rm.Flatten(false); !reflect.DeepEqual(got, wantFlatNoStdlib) {
+		t.Errorf("Flatten(false) = %v, want %v", got, wantFlatNoStdlib)
+	}
+}
+
+// TestReachMapFlattenStdlib checks that Flatten's includeStdlib toggle
+// correctly distinguishes standard-library import paths (no dot in
+// their first element) from fetchable ones.
+func TestReachMapFlattenStdlib(t *testing.T) {
+	workmap := map[string]wm{
+		"foo": {
+			ex: map[string]struct{}{
+				"fmt":            {},
+				"net/http":       {},
+				"github.com/a/b": {},
+			},
+			in: map[string]struct{}{},
+		},
+	}
+
+	rm, err := newReachMap(workmap, "")
+	if err != nil {
+		t.Fatalf("newReachMap: %v", err)
+	}
+
+	wantWithStdlib := []string{"fmt", "github.com/a/b", "net/http"}
+	if got := rm.Flatten(true); !reflect.DeepEqual(got, wantWithStdlib) {
+		t.Errorf("Flatten(true) = %v, want %v", got, wantWithStdlib)
+	}
+
+	wantWithoutStdlib := []string{"github.com/a/b"}
+	if got := rm.Flatten(false); !reflect.DeepEqual(got, wantWithoutStdlib) {
+		t.Errorf("Flatten(false) = %v, want %v", got, wantWithoutStdlib)
+	}
+}
+
+// TestReachMapErrors checks that a workmap entry's PackageErrors are
+// carried over onto the resulting ReachMap, keyed by package.
+func TestReachMapErrors(t *testing.T) {
+	workmap := map[string]wm{
+		"foo": {
+			ex: map[string]struct{}{"bar": {}},
+			in: map[string]struct{}{},
+			errs: []PackageError{
+				{Pos: "foo/broken.go", Kind: ParseError, Msg: "unexpected EOF"},
+			},
+		},
+		"foo/clean": {
+			ex: map[string]struct{}{},
+			in: map[string]struct{}{},
+		},
+	}
+
+	rm, err := newReachMap(workmap, "")
+	if err != nil {
+		t.Fatalf("newReachMap: %v", err)
+	}
+
+	if got := rm.Errors("foo"); len(got) != 1 || got[0].Kind != ParseError {
+		t.Errorf("Errors(foo) = %v, want a single ParseError", got)
+	}
+	if got := rm.Errors("foo/clean"); got != nil {
+		t.Errorf("Errors(foo/clean) = %v, want nil", got)
+	}
+}